@@ -0,0 +1,9 @@
+package milter
+
+import "errors"
+
+// ErrActionNotNegotiated is returned by Modifier methods when the
+// corresponding SMFIF_* action flag was not accepted by the MTA during
+// option negotiation, instead of writing a packet the MTA would reject.
+// Use errors.Is to check for it.
+var ErrActionNotNegotiated = errors.New("milter: action not negotiated with MTA")
@@ -0,0 +1,20 @@
+package milter
+
+// Logger is the logging surface the server accepts via an option and
+// threads into milterSession and modifier. Implementations are expected to
+// be safe for concurrent use, as a single logger is shared across sessions.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// noopLogger discards all log output and is used when no Logger option is
+// configured, so milterSession and modifier never need to nil-check logger.
+type noopLogger struct{}
+
+func (noopLogger) Debugf(format string, args ...interface{}) {}
+func (noopLogger) Infof(format string, args ...interface{})  {}
+func (noopLogger) Warnf(format string, args ...interface{})  {}
+func (noopLogger) Errorf(format string, args ...interface{}) {}
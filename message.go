@@ -0,0 +1,29 @@
+package milter
+
+// null terminates C-style strings within milter packet payloads.
+const null = "\x00"
+
+// Message is a single protocol packet exchanged between an MTA and a
+// milter: a command/response byte followed by its payload.
+type Message struct {
+	Code byte
+	Data []byte
+}
+
+// response is the builder NewResponse returns; its Response method
+// produces the Message a modifier action writes to the MTA.
+type response struct {
+	code byte
+	data []byte
+}
+
+// NewResponse starts building the Message for a modifier action,
+// identified by its SMFIR_* response code and payload.
+func NewResponse(code byte, data []byte) *response {
+	return &response{code: code, data: data}
+}
+
+// Response returns the Message r describes.
+func (r *response) Response() *Message {
+	return &Message{Code: r.code, Data: r.data}
+}
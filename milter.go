@@ -0,0 +1,48 @@
+package milter
+
+import "net"
+
+// Decision is the verdict a Milter callback returns, telling the MTA how to
+// proceed with the current connection or message.
+type Decision byte
+
+// Decisions as defined by libmilter's SMFIR_* response codes.
+const (
+	Continue Decision = 'c'
+	Accept   Decision = 'a'
+	Reject   Decision = 'r'
+	Discard  Decision = 'd'
+	TempFail Decision = 't'
+)
+
+// Milter is implemented by consumers to hook into the protocol stages an
+// MTA invokes over the lifetime of a connection. Implementing the optional
+// Session interface additionally receives Init/Disconnect lifecycle
+// notifications.
+type Milter interface {
+	// Connect is called once per connection, reporting the client the MTA
+	// accepted.
+	Connect(host string, family byte, port uint16, addr net.IP, m Modifier) (Decision, error)
+
+	// Helo is called when the client issues HELO/EHLO.
+	Helo(name string, m Modifier) (Decision, error)
+
+	// MailFrom is called for the envelope sender of a new message.
+	MailFrom(from string, m Modifier) (Decision, error)
+
+	// RcptTo is called once per envelope recipient.
+	RcptTo(rcptTo string, m Modifier) (Decision, error)
+
+	// Header is called once per message header.
+	Header(name, value string, m Modifier) (Decision, error)
+
+	// Headers is called once all headers have been seen.
+	Headers(m Modifier) (Decision, error)
+
+	// BodyChunk is called once per chunk of the message body.
+	BodyChunk(chunk []byte, m Modifier) (Decision, error)
+
+	// Body is called once the full message body has been seen, and is the
+	// last callback before the MTA delivers or rejects the message.
+	Body(m Modifier) (Decision, error)
+}
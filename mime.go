@@ -0,0 +1,172 @@
+package milter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+)
+
+// Attachment is a non-text part of a parsed message, already decoded from
+// its Content-Transfer-Encoding.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// ParsedMessage is a structured view over a message's MIME parts, built
+// lazily from the accumulated headers and buffered body. Text and HTML
+// bodies are decoded from their Content-Transfer-Encoding and, per the
+// charset Content-Type parameter, transcoded to UTF-8; everything else is
+// collected as an Attachment. Parts are returned as assembled []byte/string
+// values rather than per-part readers, since GetParsedMessage callers want
+// the whole decoded part, not streaming access to it.
+type ParsedMessage struct {
+	TextPart    string
+	HTMLPart    string
+	Attachments []Attachment
+}
+
+// parseMessage assembles a ParsedMessage from headers and a buffered body.
+// A non-multipart body is treated as a single part described by headers.
+func parseMessage(headers textproto.MIMEHeader, body []byte) (*ParsedMessage, error) {
+	msg := &ParsedMessage{}
+	if err := parsePart(msg, headers.Get("Content-Type"), headers.Get("Content-Disposition"),
+		headers.Get("Content-Transfer-Encoding"), "", body); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// parsePart decodes body per contentType/transferEncoding and feeds it into
+// msg. If contentType is itself multipart/*, it walks the part's own
+// sub-parts and recurses into each one instead of treating the boundary-
+// delimited bytes as a single opaque attachment — required for the common
+// multipart/mixed -> multipart/alternative -> text/plain+text/html shape
+// produced once a message has an attachment. Anything else is handed to
+// appendPart once decoded.
+func parsePart(msg *ParsedMessage, contentType, disposition, transferEncoding, filename string, body []byte) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		decoded, err := decodeTransferEncoding(transferEncoding, body)
+		if err != nil {
+			return err
+		}
+		appendPart(msg, contentType, disposition, filename, decoded)
+		return nil
+	}
+
+	mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return err
+		}
+		if err := parsePart(msg, part.Header.Get("Content-Type"), part.Header.Get("Content-Disposition"),
+			part.Header.Get("Content-Transfer-Encoding"), part.FileName(), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendPart classifies a decoded part as the text part, the HTML part, or
+// an attachment, based on its Content-Type and Content-Disposition. Text and
+// HTML parts are additionally transcoded to UTF-8 per the charset
+// Content-Type parameter.
+func appendPart(msg *ParsedMessage, contentType, disposition, filename string, decoded []byte) {
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+
+	if filename == "" {
+		if _, dparams, err := mime.ParseMediaType(disposition); err == nil {
+			filename = dparams["filename"]
+		}
+	}
+
+	switch {
+	case filename == "" && mediaType == "text/plain":
+		msg.TextPart = string(decodeCharset(params["charset"], decoded))
+	case filename == "" && mediaType == "text/html":
+		msg.HTMLPart = string(decodeCharset(params["charset"], decoded))
+	default:
+		msg.Attachments = append(msg.Attachments, Attachment{
+			Filename:    filename,
+			ContentType: mediaType,
+			Data:        decoded,
+		})
+	}
+}
+
+// windows1252 maps the 0x80-0x9F byte range where Windows-1252 diverges from
+// Latin-1 (curly quotes, em/en dash, ellipsis, ...) to the Unicode code
+// points it actually assigns there. Bytes below 0x80 and at/above 0xA0 equal
+// their own code point, same as Latin-1.
+var windows1252 = map[byte]rune{
+	0x80: 0x20AC, 0x82: 0x201A, 0x83: 0x0192, 0x84: 0x201E, 0x85: 0x2026,
+	0x86: 0x2020, 0x87: 0x2021, 0x88: 0x02C6, 0x89: 0x2030, 0x8A: 0x0160,
+	0x8B: 0x2039, 0x8C: 0x0152, 0x8E: 0x017D, 0x91: 0x2018, 0x92: 0x2019,
+	0x93: 0x201C, 0x94: 0x201D, 0x95: 0x2022, 0x96: 0x2013, 0x97: 0x2014,
+	0x98: 0x02DC, 0x99: 0x2122, 0x9A: 0x0161, 0x9B: 0x203A, 0x9C: 0x0153,
+	0x9E: 0x017E, 0x9F: 0x0178,
+}
+
+// decodeCharset transcodes data to UTF-8 according to charset, the
+// Content-Type charset parameter of a text/plain or text/html part.
+// ISO-8859-1 and Windows-1252, the legacy 8-bit charsets still common in
+// mail, are transcoded by mapping each byte to its Unicode code point.
+// UTF-8/US-ASCII are passed through unchanged, and any other charset is
+// returned unmodified rather than guessed at.
+func decodeCharset(charset string, data []byte) []byte {
+	var table map[byte]rune
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return data
+	case "windows-1252", "cp1252":
+		table = windows1252
+	case "iso-8859-1", "latin1":
+		table = nil
+	default:
+		return data
+	}
+
+	var b strings.Builder
+	b.Grow(len(data))
+	for _, c := range data {
+		if r, ok := table[c]; ok {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune(rune(c))
+		}
+	}
+	return []byte(b.String())
+}
+
+// decodeTransferEncoding decodes data per its Content-Transfer-Encoding.
+// Unrecognized or empty encodings are returned unmodified (7bit/8bit/binary).
+func decodeTransferEncoding(encoding string, data []byte) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		out := make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+		n, err := base64.StdEncoding.Decode(out, data)
+		if err != nil {
+			return nil, err
+		}
+		return out[:n], nil
+	case "quoted-printable":
+		return io.ReadAll(quotedprintable.NewReader(bytes.NewReader(data)))
+	default:
+		return data, nil
+	}
+}
@@ -0,0 +1,120 @@
+package milter
+
+import (
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func headerWithContentType(contentType string) textproto.MIMEHeader {
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", contentType)
+	return h
+}
+
+func TestParseMessagePlainText(t *testing.T) {
+	headers := headerWithContentType("text/plain; charset=utf-8")
+	msg, err := parseMessage(headers, []byte("hello"))
+	if err != nil {
+		t.Fatalf("parseMessage() error = %v", err)
+	}
+	if msg.TextPart != "hello" {
+		t.Errorf("TextPart = %q, want %q", msg.TextPart, "hello")
+	}
+}
+
+func TestParseMessageBase64(t *testing.T) {
+	headers := headerWithContentType("text/plain; charset=utf-8")
+	headers.Set("Content-Transfer-Encoding", "base64")
+	msg, err := parseMessage(headers, []byte("aGVsbG8="))
+	if err != nil {
+		t.Fatalf("parseMessage() error = %v", err)
+	}
+	if msg.TextPart != "hello" {
+		t.Errorf("TextPart = %q, want %q", msg.TextPart, "hello")
+	}
+}
+
+func TestParseMessageQuotedPrintable(t *testing.T) {
+	headers := headerWithContentType("text/plain; charset=utf-8")
+	headers.Set("Content-Transfer-Encoding", "quoted-printable")
+	msg, err := parseMessage(headers, []byte("caf=C3=A9"))
+	if err != nil {
+		t.Fatalf("parseMessage() error = %v", err)
+	}
+	if msg.TextPart != "café" {
+		t.Errorf("TextPart = %q, want %q", msg.TextPart, "café")
+	}
+}
+
+func TestParseMessageWindows1252Charset(t *testing.T) {
+	headers := headerWithContentType("text/plain; charset=windows-1252")
+	// "caf\x85" is "caf" followed by the Windows-1252 ellipsis byte (0x85).
+	msg, err := parseMessage(headers, []byte("caf\x85"))
+	if err != nil {
+		t.Fatalf("parseMessage() error = %v", err)
+	}
+	if msg.TextPart != "caf…" {
+		t.Errorf("TextPart = %q, want %q", msg.TextPart, "caf…")
+	}
+}
+
+func TestParseMessageLatin1Charset(t *testing.T) {
+	headers := headerWithContentType("text/plain; charset=iso-8859-1")
+	msg, err := parseMessage(headers, []byte("caf\xe9"))
+	if err != nil {
+		t.Fatalf("parseMessage() error = %v", err)
+	}
+	if msg.TextPart != "café" {
+		t.Errorf("TextPart = %q, want %q", msg.TextPart, "café")
+	}
+}
+
+// TestParseMessageNestedMultipart covers the multipart/mixed ->
+// multipart/alternative -> text/plain+text/html shape produced by virtually
+// every HTML-capable mail client once a message has an attachment.
+func TestParseMessageNestedMultipart(t *testing.T) {
+	raw := strings.Join([]string{
+		"--mixed",
+		`Content-Type: multipart/alternative; boundary="alt"`,
+		"",
+		"--alt",
+		"Content-Type: text/plain; charset=utf-8",
+		"",
+		"plain body",
+		"--alt",
+		"Content-Type: text/html; charset=utf-8",
+		"",
+		"<p>html body</p>",
+		"--alt--",
+		"--mixed",
+		`Content-Type: application/pdf`,
+		`Content-Disposition: attachment; filename="report.pdf"`,
+		"Content-Transfer-Encoding: base64",
+		"",
+		"aGVsbG8=",
+		"--mixed--",
+		"",
+	}, "\r\n")
+
+	headers := headerWithContentType(`multipart/mixed; boundary="mixed"`)
+	msg, err := parseMessage(headers, []byte(raw))
+	if err != nil {
+		t.Fatalf("parseMessage() error = %v", err)
+	}
+	if msg.TextPart != "plain body" {
+		t.Errorf("TextPart = %q, want %q", msg.TextPart, "plain body")
+	}
+	if msg.HTMLPart != "<p>html body</p>" {
+		t.Errorf("HTMLPart = %q, want %q", msg.HTMLPart, "<p>html body</p>")
+	}
+	if len(msg.Attachments) != 1 {
+		t.Fatalf("len(Attachments) = %d, want 1", len(msg.Attachments))
+	}
+	if msg.Attachments[0].Filename != "report.pdf" {
+		t.Errorf("Attachments[0].Filename = %q, want %q", msg.Attachments[0].Filename, "report.pdf")
+	}
+	if string(msg.Attachments[0].Data) != "hello" {
+		t.Errorf("Attachments[0].Data = %q, want %q", msg.Attachments[0].Data, "hello")
+	}
+}
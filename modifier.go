@@ -20,6 +20,11 @@ type Modifier interface {
 	// AddRecipient appends a new envelope recipient for current message
 	AddRecipient(r string) error
 
+	// AddRecipientWithArgs appends a new envelope recipient along with
+	// ESMTP MAIL/RCPT parameters, requiring SMFIF_ADDRCPT_PAR to be
+	// negotiated with the MTA
+	AddRecipientWithArgs(rcpt, args string) error
+
 	// DeleteRecipient removes an envelope recipient address from message
 	DeleteRecipient(r string) error
 
@@ -42,55 +47,162 @@ type Modifier interface {
 	// ChangeFrom replaces the FROM envelope header with a new one
 	ChangeFrom(value string) error
 
+	// Progress sends a progress notification (SMFIR_PROGRESS) to reset the
+	// MTA's per-stage timeout. It carries no state change and expects no
+	// reply, so it is safe to call from any handler stage, repeatedly.
+	Progress() error
+
 	// GetMacros returns Macros
 	GetMacros() map[string]string
 
 	// GetHeaders returns Headers
 	GetHeaders() textproto.MIMEHeader
+
+	// GetSessionID returns the ID generated once per TCP connection
+	GetSessionID() string
+
+	// GetMessageID returns the ID regenerated for the current MAIL FROM
+	GetMessageID() string
+
+	// GetMacroRequests returns the per-stage macro names configured via the
+	// server's MacroRequests option. They are sent to the MTA via
+	// SMFIC_MACRO/SetSymList only if it accepted SMFIF_SETSYMLIST.
+	GetMacroRequests() map[Stage][]string
+
+	// GetParsedMessage lazily assembles the accumulated headers and
+	// buffered body into a ParsedMessage. It requires the server's
+	// ParseMessage option to be enabled, and caches its result so
+	// repeated calls from the EOM handler are cheap.
+	GetParsedMessage() (*ParsedMessage, error)
 }
 
 type modifier struct {
 	Macros  map[string]string
 	Headers textproto.MIMEHeader
 
+	// Actions holds the SMFIF_* flags the MTA accepted during option
+	// negotiation, used to reject unsupported modification requests early.
+	Actions OptAction
+
+	SessionID string
+	MessageID string
+
+	// MacroRequests holds the per-stage macro names configured via the
+	// server's MacroRequests option
+	MacroRequests map[Stage][]string
+
+	// Body is the buffered message body accumulated so far, used by
+	// GetParsedMessage.
+	Body []byte
+
+	// ParseMessage opts into GetParsedMessage. Left false, GetParsedMessage
+	// returns an error so callers that only touch headers don't pay for
+	// MIME parsing.
+	ParseMessage bool
+
+	parsedMessage *ParsedMessage
+	parsedErr     error
+	parsedDone    bool
+
+	logger Logger
+
 	writePacket func(*Message) error
 }
 
+// checkAction returns ErrActionNotNegotiated wrapped with the flag's name if
+// action was not accepted by the MTA during option negotiation.
+func (m *modifier) checkAction(action OptAction, name string) error {
+	if m.Actions&action == 0 {
+		return fmt.Errorf("%w: %s", ErrActionNotNegotiated, name)
+	}
+	return nil
+}
+
+// writeResponse logs the packet about to be written at debug level (by
+// command byte and payload length), writes it, and logs any resulting I/O
+// error at error level before returning it to the caller.
+func (m *modifier) writeResponse(code byte, data []byte) error {
+	m.logger.Debugf("session=%s message=%s: write %c packet (%d bytes)", m.SessionID, m.MessageID, code, len(data))
+	if err := m.writePacket(NewResponse(code, data).Response()); err != nil {
+		m.logger.Errorf("session=%s message=%s: write %c packet: %v", m.SessionID, m.MessageID, code, err)
+		return err
+	}
+	return nil
+}
+
 // AddRecipient appends a new envelope recipient for current message
 func (m *modifier) AddRecipient(r string) error {
+	if err := m.checkAction(OptAddRcpt, "SMFIF_ADDRCPT"); err != nil {
+		return err
+	}
+	m.logger.Infof("session=%s message=%s: add recipient %s", m.SessionID, m.MessageID, r)
 	data := []byte(fmt.Sprintf("<%s>", r) + null)
-	return m.writePacket(NewResponse('+', data).Response())
+	return m.writeResponse('+', data)
+}
+
+// AddRecipientWithArgs appends a new envelope recipient together with ESMTP
+// MAIL/RCPT parameters (e.g. NOTIFY=, ORCPT=, BODY=) via SMFIR_ADDRCPT_PAR.
+// The MTA must have accepted SMFIF_ADDRCPT_PAR during option negotiation,
+// otherwise an error is returned instead of silently writing a packet the
+// MTA would reject.
+func (m *modifier) AddRecipientWithArgs(rcpt, args string) error {
+	if err := m.checkAction(OptAddRcptPar, "SMFIF_ADDRCPT_PAR"); err != nil {
+		return err
+	}
+	m.logger.Infof("session=%s message=%s: add recipient %s with args %q", m.SessionID, m.MessageID, rcpt, args)
+	data := []byte(fmt.Sprintf("<%s>", rcpt) + null + args + null)
+	return m.writeResponse('2', data)
 }
 
 // DeleteRecipient removes an envelope recipient address from message
 func (m *modifier) DeleteRecipient(r string) error {
+	if err := m.checkAction(OptRemoveRcpt, "SMFIF_DELRCPT"); err != nil {
+		return err
+	}
+	m.logger.Infof("session=%s message=%s: delete recipient %s", m.SessionID, m.MessageID, r)
 	data := []byte(fmt.Sprintf("<%s>", r) + null)
-	return m.writePacket(NewResponse('-', data).Response())
+	return m.writeResponse('-', data)
 }
 
 // ReplaceBody substitutes message body with provided body
 func (m *modifier) ReplaceBody(body []byte) error {
+	if err := m.checkAction(OptChangeBody, "SMFIF_CHGBODY"); err != nil {
+		return err
+	}
+	m.logger.Infof("session=%s message=%s: replace body (%d bytes)", m.SessionID, m.MessageID, len(body))
 	body = crlfToLF(body)
-	return m.writePacket(NewResponse('b', body).Response())
+	return m.writeResponse('b', body)
 }
 
 // AddHeader appends a new email message header the message
 func (m *modifier) AddHeader(name, value string) error {
+	if err := m.checkAction(OptAddHeader, "SMFIF_ADDHDRS"); err != nil {
+		return err
+	}
+	m.logger.Infof("session=%s message=%s: add header %s", m.SessionID, m.MessageID, name)
 	var buffer bytes.Buffer
 	buffer.WriteString(name + null)
 	buffer.Write(crlfToLF([]byte(value)))
 	buffer.WriteString(null)
-	return m.writePacket(NewResponse('h', buffer.Bytes()).Response())
+	return m.writeResponse('h', buffer.Bytes())
 }
 
 // Quarantine a message by giving a reason to hold it
 func (m *modifier) Quarantine(reason string) error {
-	return m.writePacket(NewResponse('q', []byte(reason+null)).Response())
+	if err := m.checkAction(OptQuarantine, "SMFIF_QUARANTINE"); err != nil {
+		return err
+	}
+	m.logger.Infof("session=%s message=%s: quarantine %q", m.SessionID, m.MessageID, reason)
+	return m.writeResponse('q', []byte(reason+null))
 }
 
 // ChangeHeader replaces the header at the specified position with a new one.
 // The index is per name.
 func (m *modifier) ChangeHeader(index int, name, value string) error {
+	if err := m.checkAction(OptChangeHeader, "SMFIF_CHGHDRS"); err != nil {
+		return err
+	}
+	m.logger.Infof("session=%s message=%s: change header %s[%d]", m.SessionID, m.MessageID, name, index)
 	var buffer bytes.Buffer
 	if err := binary.Write(&buffer, binary.BigEndian, uint32(index)); err != nil {
 		return err
@@ -98,11 +210,15 @@ func (m *modifier) ChangeHeader(index int, name, value string) error {
 	buffer.WriteString(name + null)
 	buffer.Write(crlfToLF([]byte(value)))
 	buffer.WriteString(null)
-	return m.writePacket(NewResponse('m', buffer.Bytes()).Response())
+	return m.writeResponse('m', buffer.Bytes())
 }
 
 // InsertHeader inserts the header at the specified position
 func (m *modifier) InsertHeader(index int, name, value string) error {
+	if err := m.checkAction(OptChangeHeader, "SMFIF_CHGHDRS"); err != nil {
+		return err
+	}
+	m.logger.Infof("session=%s message=%s: insert header %s[%d]", m.SessionID, m.MessageID, name, index)
 	var buffer bytes.Buffer
 	if err := binary.Write(&buffer, binary.BigEndian, uint32(index)); err != nil {
 		return err
@@ -110,13 +226,23 @@ func (m *modifier) InsertHeader(index int, name, value string) error {
 	buffer.WriteString(name + null)
 	buffer.Write(crlfToLF([]byte(value)))
 	buffer.WriteString(null)
-	return m.writePacket(NewResponse('i', buffer.Bytes()).Response())
+	return m.writeResponse('i', buffer.Bytes())
 }
 
 // ChangeFrom replaces the FROM envelope header with a new one
 func (m *modifier) ChangeFrom(value string) error {
+	if err := m.checkAction(OptChangeFrom, "SMFIF_CHGFROM"); err != nil {
+		return err
+	}
+	m.logger.Infof("session=%s message=%s: change from %s", m.SessionID, m.MessageID, value)
 	data := []byte(value + null)
-	return m.writePacket(NewResponse('e', data).Response())
+	return m.writeResponse('e', data)
+}
+
+// Progress sends a progress notification (SMFIR_PROGRESS) to reset the
+// MTA's per-stage timeout. It carries no state change and expects no reply.
+func (m *modifier) Progress() error {
+	return m.writeResponse('p', nil)
 }
 
 // GetMacros returns Macros
@@ -129,11 +255,52 @@ func (m *modifier) GetHeaders() textproto.MIMEHeader {
 	return m.Headers
 }
 
+// GetSessionID returns the ID generated once per TCP connection
+func (m *modifier) GetSessionID() string {
+	return m.SessionID
+}
+
+// GetMessageID returns the ID regenerated for the current MAIL FROM
+func (m *modifier) GetMessageID() string {
+	return m.MessageID
+}
+
+// GetMacroRequests returns the per-stage macro names configured via the
+// server's MacroRequests option, whether or not the MTA accepted
+// SMFIF_SETSYMLIST
+func (m *modifier) GetMacroRequests() map[Stage][]string {
+	return m.MacroRequests
+}
+
+// GetParsedMessage lazily assembles the accumulated headers and buffered
+// body into a ParsedMessage, caching the result for repeated calls.
+func (m *modifier) GetParsedMessage() (*ParsedMessage, error) {
+	if !m.ParseMessage {
+		return nil, fmt.Errorf("milter: MIME parsing not enabled, set the ParseMessage server option")
+	}
+	if !m.parsedDone {
+		m.parsedMessage, m.parsedErr = parseMessage(m.Headers, m.Body)
+		m.parsedDone = true
+	}
+	return m.parsedMessage, m.parsedErr
+}
+
 // newModifier creates a new Modifier instance from milterSession
 func newModifier(s *milterSession) Modifier {
+	logger := s.logger
+	if logger == nil {
+		logger = noopLogger{}
+	}
 	return &modifier{
-		Macros:      s.macros,
-		Headers:     s.headers,
-		writePacket: s.WritePacket,
+		Macros:        s.macros,
+		Headers:       s.headers,
+		Actions:       s.actions,
+		SessionID:     s.sessionID,
+		MessageID:     s.messageID,
+		MacroRequests: s.macroRequests,
+		Body:          s.body,
+		ParseMessage:  s.parseMessage,
+		logger:        logger,
+		writePacket:   s.WritePacket,
 	}
 }
@@ -0,0 +1,123 @@
+package milter
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// recordingLogger captures log calls for assertions instead of discarding
+// them like noopLogger.
+type recordingLogger struct {
+	debugf []string
+	errorf []string
+}
+
+func (l *recordingLogger) Debugf(format string, args ...interface{}) {
+	l.debugf = append(l.debugf, fmt.Sprintf(format, args...))
+}
+func (l *recordingLogger) Infof(format string, args ...interface{}) {}
+func (l *recordingLogger) Warnf(format string, args ...interface{}) {}
+func (l *recordingLogger) Errorf(format string, args ...interface{}) {
+	l.errorf = append(l.errorf, fmt.Sprintf(format, args...))
+}
+
+func TestWriteResponseLogsPacketAtDebug(t *testing.T) {
+	logger := &recordingLogger{}
+	m := &modifier{
+		SessionID:   "sess1",
+		MessageID:   "msg1",
+		logger:      logger,
+		writePacket: func(*Message) error { return nil },
+	}
+
+	if err := m.writeResponse('p', nil); err != nil {
+		t.Fatalf("writeResponse() error = %v", err)
+	}
+	if len(logger.debugf) != 1 {
+		t.Fatalf("Debugf called %d times, want 1", len(logger.debugf))
+	}
+	if len(logger.errorf) != 0 {
+		t.Fatalf("Errorf called %d times, want 0", len(logger.errorf))
+	}
+}
+
+func TestAddRecipientWithArgsRejectedWithoutNegotiation(t *testing.T) {
+	m := &modifier{
+		logger:      noopLogger{},
+		writePacket: func(*Message) error { t.Fatal("writePacket called without negotiation"); return nil },
+	}
+
+	err := m.AddRecipientWithArgs("user@example.com", "NOTIFY=SUCCESS,FAILURE")
+	if !errors.Is(err, ErrActionNotNegotiated) {
+		t.Fatalf("AddRecipientWithArgs() error = %v, want ErrActionNotNegotiated", err)
+	}
+}
+
+func TestAddRecipientWithArgsWireFormat(t *testing.T) {
+	var sent *Message
+	m := &modifier{
+		Actions: OptAddRcptPar,
+		logger:  noopLogger{},
+		writePacket: func(msg *Message) error {
+			sent = msg
+			return nil
+		},
+	}
+
+	if err := m.AddRecipientWithArgs("user@example.com", "NOTIFY=SUCCESS,FAILURE"); err != nil {
+		t.Fatalf("AddRecipientWithArgs() error = %v", err)
+	}
+	if sent == nil {
+		t.Fatal("writePacket was not called")
+	}
+	if sent.Code != '2' {
+		t.Errorf("Code = %q, want %q (SMFIR_ADDRCPT_PAR)", sent.Code, '2')
+	}
+	want := "<user@example.com>" + null + "NOTIFY=SUCCESS,FAILURE" + null
+	if string(sent.Data) != want {
+		t.Errorf("Data = %q, want %q", sent.Data, want)
+	}
+}
+
+func TestProgressWireFormat(t *testing.T) {
+	var sent *Message
+	m := &modifier{
+		logger: noopLogger{},
+		writePacket: func(msg *Message) error {
+			sent = msg
+			return nil
+		},
+	}
+
+	if err := m.Progress(); err != nil {
+		t.Fatalf("Progress() error = %v", err)
+	}
+	if sent == nil {
+		t.Fatal("writePacket was not called")
+	}
+	if sent.Code != 'p' {
+		t.Errorf("Code = %q, want %q (SMFIR_PROGRESS)", sent.Code, 'p')
+	}
+	if len(sent.Data) != 0 {
+		t.Errorf("Data = %q, want empty (SMFIR_PROGRESS carries no payload)", sent.Data)
+	}
+}
+
+func TestWriteResponseLogsWriteErrorAtError(t *testing.T) {
+	logger := &recordingLogger{}
+	wantErr := errors.New("connection reset")
+	m := &modifier{
+		SessionID:   "sess1",
+		MessageID:   "msg1",
+		logger:      logger,
+		writePacket: func(*Message) error { return wantErr },
+	}
+
+	if err := m.writeResponse('b', []byte("body")); !errors.Is(err, wantErr) {
+		t.Fatalf("writeResponse() error = %v, want %v", err, wantErr)
+	}
+	if len(logger.errorf) != 1 {
+		t.Fatalf("Errorf called %d times, want 1", len(logger.errorf))
+	}
+}
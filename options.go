@@ -0,0 +1,87 @@
+package milter
+
+import "bytes"
+
+// OptAction represents the SMFIF_* action bits an MTA and milter negotiate
+// during the option exchange. A milter may only perform an action if the
+// corresponding bit was accepted by the MTA.
+type OptAction uint32
+
+// Action bits as defined by libmilter's mfapi.h.
+const (
+	OptAddHeader    OptAction = 0x00000001 // SMFIF_ADDHDRS
+	OptChangeBody   OptAction = 0x00000002 // SMFIF_CHGBODY
+	OptAddRcpt      OptAction = 0x00000004 // SMFIF_ADDRCPT
+	OptRemoveRcpt   OptAction = 0x00000008 // SMFIF_DELRCPT
+	OptChangeHeader OptAction = 0x00000010 // SMFIF_CHGHDRS
+	OptQuarantine   OptAction = 0x00000020 // SMFIF_QUARANTINE
+	OptChangeFrom   OptAction = 0x00000040 // SMFIF_CHGFROM
+
+	// OptAddRcptPar allows a milter to append a recipient together with
+	// ESMTP MAIL/RCPT parameters via SMFIR_ADDRCPT_PAR.
+	OptAddRcptPar OptAction = 0x00000080 // SMFIF_ADDRCPT_PAR
+
+	// OptSetSymList allows a milter to request specific macros per stage
+	// via SMFIC_MACRO instead of receiving whatever the MTA sends by
+	// default.
+	OptSetSymList OptAction = 0x00000100 // SMFIF_SETSYMLIST
+)
+
+// RequestedActions is the set of SMFIF_* actions milterSession requests
+// from the MTA during the SMFIC_OPTNEG option exchange. It includes every
+// action a Modifier method is gated on via checkAction, so that an MTA
+// advertising support for an action actually gets asked for it instead of
+// the bit only being checked client-side after the fact.
+const RequestedActions OptAction = OptAddHeader | OptChangeBody | OptAddRcpt | OptRemoveRcpt |
+	OptChangeHeader | OptQuarantine | OptChangeFrom | OptAddRcptPar | OptSetSymList
+
+// macroStageCodes maps a Stage to the per-stage code carried as the first
+// payload byte of an SMFIC_MACRO packet, identifying which callback stage
+// the macro list applies to.
+var macroStageCodes = map[Stage]byte{
+	StageConnect: 'C',
+	StageHelo:    'H',
+	StageMail:    'M',
+	StageRcpt:    'R',
+	StageData:    'T',
+	StageEOH:     'N',
+	StageEOM:     'E',
+	StageUnknown: 'O',
+}
+
+// macroListPacket builds the SMFIC_MACRO ('D') packet requesting names for
+// stage. It returns nil if stage has no macroStageCodes entry or names is
+// empty, since there is nothing to negotiate in that case.
+func macroListPacket(stage Stage, names []string) *Message {
+	code, ok := macroStageCodes[stage]
+	if !ok || len(names) == 0 {
+		return nil
+	}
+	var buffer bytes.Buffer
+	buffer.WriteByte(code)
+	for _, name := range names {
+		buffer.WriteString(name + null)
+	}
+	return NewResponse('D', buffer.Bytes()).Response()
+}
+
+// sendMacroRequests emits one SMFIC_MACRO packet per stage in requests, so
+// the MTA knows to include those macros when it invokes the corresponding
+// callback. It is a no-op unless the MTA has accepted SMFIF_SETSYMLIST.
+// milterSession calls this during option negotiation, after actions is
+// known and before the first stage callback.
+func sendMacroRequests(writePacket func(*Message) error, actions OptAction, requests map[Stage][]string) error {
+	if actions&OptSetSymList == 0 {
+		return nil
+	}
+	for stage, names := range requests {
+		packet := macroListPacket(stage, names)
+		if packet == nil {
+			continue
+		}
+		if err := writePacket(packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package milter
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMacroListPacket(t *testing.T) {
+	packet := macroListPacket(StageMail, []string{"{auth_authen}", "{cert_subject}"})
+	if packet == nil {
+		t.Fatal("macroListPacket() = nil, want a packet")
+	}
+	if packet.Code != 'D' {
+		t.Errorf("Code = %q, want %q (SMFIC_MACRO)", packet.Code, 'D')
+	}
+	want := "M" + "{auth_authen}" + null + "{cert_subject}" + null
+	if string(packet.Data) != want {
+		t.Errorf("Data = %q, want %q", packet.Data, want)
+	}
+}
+
+func TestMacroListPacketNoNames(t *testing.T) {
+	if packet := macroListPacket(StageMail, nil); packet != nil {
+		t.Errorf("macroListPacket() with no names = %+v, want nil", packet)
+	}
+}
+
+func TestMacroListPacketUnknownStage(t *testing.T) {
+	if packet := macroListPacket(Stage(99), []string{"{foo}"}); packet != nil {
+		t.Errorf("macroListPacket() with unknown stage = %+v, want nil", packet)
+	}
+}
+
+func TestSendMacroRequestsRequiresSetSymList(t *testing.T) {
+	var sent []*Message
+	writePacket := func(m *Message) error {
+		sent = append(sent, m)
+		return nil
+	}
+	requests := map[Stage][]string{StageMail: {"{auth_authen}"}}
+
+	if err := sendMacroRequests(writePacket, 0, requests); err != nil {
+		t.Fatalf("sendMacroRequests() error = %v", err)
+	}
+	if len(sent) != 0 {
+		t.Fatalf("sendMacroRequests() without SMFIF_SETSYMLIST wrote %d packets, want 0", len(sent))
+	}
+
+	if err := sendMacroRequests(writePacket, OptSetSymList, requests); err != nil {
+		t.Fatalf("sendMacroRequests() error = %v", err)
+	}
+	if len(sent) != 1 {
+		t.Fatalf("sendMacroRequests() with SMFIF_SETSYMLIST wrote %d packets, want 1", len(sent))
+	}
+}
+
+func TestSendMacroRequestsPropagatesWriteError(t *testing.T) {
+	wantErr := errors.New("boom")
+	writePacket := func(m *Message) error { return wantErr }
+	requests := map[Stage][]string{StageMail: {"{auth_authen}"}}
+
+	if err := sendMacroRequests(writePacket, OptSetSymList, requests); !errors.Is(err, wantErr) {
+		t.Errorf("sendMacroRequests() error = %v, want %v", err, wantErr)
+	}
+}
+
+func TestRequestedActionsIncludesAddRcptPar(t *testing.T) {
+	if RequestedActions&OptAddRcptPar == 0 {
+		t.Error("RequestedActions does not include SMFIF_ADDRCPT_PAR")
+	}
+}
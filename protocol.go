@@ -0,0 +1,61 @@
+package milter
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// SMFIC_* command bytes sent by the MTA to a milter.
+const (
+	smficOptneg  = 'O'
+	smficMacro   = 'D'
+	smficConnect = 'C'
+	smficHelo    = 'H'
+	smficMail    = 'M'
+	smficRcpt    = 'R'
+	smficHeader  = 'L'
+	smficEoh     = 'N'
+	smficBody    = 'B'
+	smficBodyEob = 'E'
+	smficAbort   = 'A'
+	smficQuit    = 'Q'
+)
+
+// maxPacketSize bounds a single packet's payload, guarding against a
+// corrupt length prefix driving an unbounded allocation.
+const maxPacketSize = 64 * 1024 * 1024
+
+// readPacket reads one length-prefixed packet off r: a 4-byte big-endian
+// length covering the command byte and payload, followed by that many
+// bytes.
+func readPacket(r *bufio.Reader) (*Message, error) {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	if length == 0 || length > maxPacketSize {
+		return nil, fmt.Errorf("milter: invalid packet length %d", length)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return &Message{Code: buf[0], Data: buf[1:]}, nil
+}
+
+// writePacket encodes msg as a length-prefixed packet and flushes it to w.
+func writePacket(w *bufio.Writer, msg *Message) error {
+	length := uint32(1 + len(msg.Data))
+	if err := binary.Write(w, binary.BigEndian, length); err != nil {
+		return err
+	}
+	if err := w.WriteByte(msg.Code); err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Data); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -0,0 +1,263 @@
+package milter
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+)
+
+// Options configures a Server.
+type Options struct {
+	// Logger receives structured logs for protocol packets, modifier
+	// actions, and errors. Defaults to a no-op logger.
+	Logger Logger
+
+	// ParseMessage opts every session into GetParsedMessage.
+	ParseMessage bool
+
+	// MacroRequests are the per-stage macro names requested from the MTA
+	// via SMFIC_MACRO, gated on the MTA accepting SMFIF_SETSYMLIST.
+	MacroRequests map[Stage][]string
+}
+
+// Server accepts milter connections and dispatches protocol stages to a
+// Milter built fresh for each one.
+type Server struct {
+	newMilter func() Milter
+	options   Options
+}
+
+// NewServer creates a Server that constructs a Milter via newMilter for
+// each accepted connection.
+func NewServer(newMilter func() Milter, options Options) *Server {
+	if options.Logger == nil {
+		options.Logger = noopLogger{}
+	}
+	return &Server{newMilter: newMilter, options: options}
+}
+
+// Serve accepts connections from listener until it returns an error (e.g.
+// because it was closed), handling each on its own goroutine.
+func (srv *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go srv.handleConnection(conn)
+	}
+}
+
+// handleConnection runs one milter session to completion.
+func (srv *Server) handleConnection(conn net.Conn) {
+	defer conn.Close()
+	s := &milterSession{
+		reader:        bufio.NewReader(conn),
+		writer:        bufio.NewWriter(conn),
+		macroRequests: srv.options.MacroRequests,
+		parseMessage:  srv.options.ParseMessage,
+		logger:        srv.options.Logger,
+		milter:        srv.newMilter(),
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Errorf("session=%s: panic in milter callback: %v", s.sessionID, r)
+		}
+	}()
+	s.serve()
+}
+
+// milterSession holds the per-connection protocol state for one accepted
+// MTA connection: the negotiated actions and macro requests, the envelope
+// currently being processed, and the wire plumbing used to exchange
+// packets. newModifier builds a Modifier view over it for each Milter
+// callback.
+type milterSession struct {
+	reader *bufio.Reader
+	writer *bufio.Writer
+
+	sessionID string
+	messageID string
+
+	actions       OptAction
+	macroRequests map[Stage][]string
+	macros        map[string]string
+	headers       textproto.MIMEHeader
+	body          []byte
+
+	parseMessage bool
+	logger       Logger
+
+	milter Milter
+}
+
+// WritePacket writes msg to the MTA.
+func (s *milterSession) WritePacket(msg *Message) error {
+	return writePacket(s.writer, msg)
+}
+
+// resetEnvelope clears the per-message state accumulated since the last
+// MAIL FROM (or connection start), without touching the connection-level
+// session ID or negotiated actions.
+func (s *milterSession) resetEnvelope() {
+	s.macros = map[string]string{}
+	s.headers = textproto.MIMEHeader{}
+	s.body = nil
+}
+
+// negotiateOptions handles the MTA's SMFIC_OPTNEG packet: it computes the
+// actions both sides support by intersecting RequestedActions with what the
+// MTA reports support for, replies with milter's own SMFIC_OPTNEG, and then
+// requests the per-stage macros in s.macroRequests.
+func (s *milterSession) negotiateOptions(msg *Message) error {
+	if len(msg.Data) < 12 {
+		return fmt.Errorf("milter: short SMFIC_OPTNEG packet (%d bytes)", len(msg.Data))
+	}
+	mtaActions := binary.BigEndian.Uint32(msg.Data[4:8])
+	s.actions = OptAction(mtaActions) & RequestedActions
+
+	var reply [12]byte
+	binary.BigEndian.PutUint32(reply[0:4], 6) // milter protocol version 6
+	binary.BigEndian.PutUint32(reply[4:8], uint32(s.actions))
+	if err := s.WritePacket(&Message{Code: smficOptneg, Data: reply[:]}); err != nil {
+		return err
+	}
+	return sendMacroRequests(s.WritePacket, s.actions, s.macroRequests)
+}
+
+// handleMacro records the name/value pairs of an SMFIC_MACRO packet the MTA
+// sends ahead of a stage callback (distinct from the macro *names* milter
+// itself requests during negotiation via sendMacroRequests).
+func (s *milterSession) handleMacro(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	fields := strings.Split(string(data[1:]), null)
+	for i := 0; i+1 < len(fields); i += 2 {
+		s.macros[fields[i]] = fields[i+1]
+	}
+}
+
+// serve reads packets from the MTA until it disconnects or sends
+// SMFIC_QUIT, dispatching each one in turn. sessionID is assigned once, up
+// front, and notifyDisconnect fires when the loop returns for any reason.
+func (s *milterSession) serve() {
+	s.sessionID = newID()
+	s.resetEnvelope()
+	defer notifyDisconnect(s.milter)
+	for {
+		msg, err := readPacket(s.reader)
+		if err != nil {
+			if err != io.EOF {
+				s.logger.Errorf("session=%s: read packet: %v", s.sessionID, err)
+			}
+			return
+		}
+		s.logger.Debugf("session=%s: read %c packet (%d bytes)", s.sessionID, msg.Code, len(msg.Data))
+
+		if err := s.dispatch(msg); err != nil {
+			s.logger.Errorf("session=%s: handle %c packet: %v", s.sessionID, msg.Code, err)
+			return
+		}
+		if msg.Code == smficQuit {
+			return
+		}
+	}
+}
+
+// dispatch handles one packet from the MTA.
+func (s *milterSession) dispatch(msg *Message) error {
+	switch msg.Code {
+	case smficOptneg:
+		return s.negotiateOptions(msg)
+	case smficMacro:
+		s.handleMacro(msg.Data)
+		return nil
+	case smficConnect:
+		host, family, port, addr := parseConnect(msg.Data)
+		return s.reply(s.milter.Connect(host, family, port, addr, newModifier(s)))
+	case smficHelo:
+		name := strings.TrimSuffix(string(msg.Data), null)
+		return s.reply(s.milter.Helo(name, newModifier(s)))
+	case smficMail:
+		s.messageID = newID()
+		notifyInit(s.milter, s.sessionID, s.messageID)
+		return s.reply(s.milter.MailFrom(firstField(msg.Data), newModifier(s)))
+	case smficRcpt:
+		return s.reply(s.milter.RcptTo(firstField(msg.Data), newModifier(s)))
+	case smficHeader:
+		name, value := parseHeader(msg.Data)
+		s.headers.Add(name, value)
+		return s.reply(s.milter.Header(name, value, newModifier(s)))
+	case smficEoh:
+		return s.reply(s.milter.Headers(newModifier(s)))
+	case smficBody:
+		if s.parseMessage {
+			s.body = append(s.body, msg.Data...)
+		}
+		return s.reply(s.milter.BodyChunk(msg.Data, newModifier(s)))
+	case smficBodyEob:
+		if err := s.reply(s.milter.Body(newModifier(s))); err != nil {
+			return err
+		}
+		s.resetEnvelope()
+		return nil
+	case smficAbort:
+		s.resetEnvelope()
+		return nil
+	case smficQuit:
+		return nil
+	default:
+		return s.WritePacket(&Message{Code: byte(Continue)})
+	}
+}
+
+// parseHeader splits an SMFIC_HEADER payload into its name and value,
+// which are NUL-terminated in sequence.
+func parseHeader(data []byte) (name, value string) {
+	fields := strings.SplitN(strings.TrimSuffix(string(data), null), null, 2)
+	if len(fields) < 2 {
+		return fields[0], ""
+	}
+	return fields[0], fields[1]
+}
+
+// reply writes decision to the MTA, unless the callback itself returned an
+// error, in which case that error is propagated instead so serve can log
+// and close the connection.
+func (s *milterSession) reply(decision Decision, err error) error {
+	if err != nil {
+		return err
+	}
+	return s.WritePacket(&Message{Code: byte(decision)})
+}
+
+// firstField returns the first NUL-terminated field of data, i.e. the
+// envelope address in an SMFIC_MAIL/SMFIC_RCPT packet, ignoring any ESMTP
+// parameters that follow it.
+func firstField(data []byte) string {
+	if i := strings.IndexByte(string(data), 0); i >= 0 {
+		return string(data[:i])
+	}
+	return string(data)
+}
+
+// parseConnect decodes an SMFIC_CONNECT payload: a NUL-terminated hostname,
+// a 1-byte address family, a big-endian uint16 port, and a NUL-terminated
+// address string.
+func parseConnect(data []byte) (host string, family byte, port uint16, addr net.IP) {
+	parts := strings.SplitN(string(data), null, 2)
+	host = parts[0]
+	if len(parts) < 2 || len(parts[1]) < 3 {
+		return host, 0, 0, nil
+	}
+	rest := []byte(parts[1])
+	family = rest[0]
+	port = binary.BigEndian.Uint16(rest[1:3])
+	addr = net.ParseIP(strings.TrimSuffix(string(rest[3:]), null))
+	return host, family, port, addr
+}
@@ -0,0 +1,174 @@
+package milter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/textproto"
+	"testing"
+)
+
+// stubMilter records the Init, Disconnect, Header and Body callbacks and
+// always returns Continue,
+// so tests can drive milterSession.dispatch and assert on what it saw.
+type stubMilter struct {
+	DefaultSession
+
+	inits       int
+	disconnects int
+	lastSession string
+	lastMessage string
+	headersSeen []string
+	bodyMod     Modifier
+}
+
+func (s *stubMilter) Init(sessionID, messageID string) {
+	s.inits++
+	s.lastSession = sessionID
+	s.lastMessage = messageID
+}
+func (s *stubMilter) Disconnect() { s.disconnects++ }
+
+func (s *stubMilter) Connect(string, byte, uint16, net.IP, Modifier) (Decision, error) {
+	return Continue, nil
+}
+func (s *stubMilter) Helo(string, Modifier) (Decision, error) { return Continue, nil }
+func (s *stubMilter) MailFrom(string, Modifier) (Decision, error) {
+	return Continue, nil
+}
+func (s *stubMilter) RcptTo(string, Modifier) (Decision, error) { return Continue, nil }
+func (s *stubMilter) Header(name, value string, m Modifier) (Decision, error) {
+	s.headersSeen = append(s.headersSeen, name+"="+value)
+	return Continue, nil
+}
+func (s *stubMilter) Headers(Modifier) (Decision, error)           { return Continue, nil }
+func (s *stubMilter) BodyChunk([]byte, Modifier) (Decision, error) { return Continue, nil }
+func (s *stubMilter) Body(m Modifier) (Decision, error) {
+	s.bodyMod = m
+	return Continue, nil
+}
+
+// newTestSession builds a milterSession that dispatch can be driven
+// directly against; out collects everything the session writes back to the
+// MTA, for tests that need to assert on the wire traffic dispatch produces.
+func newTestSession(milter Milter, out *bytes.Buffer) *milterSession {
+	return &milterSession{
+		reader:       bufio.NewReader(&bytes.Buffer{}),
+		writer:       bufio.NewWriter(out),
+		headers:      textproto.MIMEHeader{},
+		logger:       noopLogger{},
+		milter:       milter,
+		parseMessage: true,
+	}
+}
+
+func optnegPacket(mtaActions OptAction) *Message {
+	var data [12]byte
+	binary.BigEndian.PutUint32(data[0:4], 6)
+	binary.BigEndian.PutUint32(data[4:8], uint32(mtaActions))
+	return &Message{Code: smficOptneg, Data: data[:]}
+}
+
+func TestNegotiateOptionsIntersectsActions(t *testing.T) {
+	s := newTestSession(&stubMilter{}, &bytes.Buffer{})
+	if err := s.dispatch(optnegPacket(OptAddRcptPar | OptChangeFrom)); err != nil {
+		t.Fatalf("dispatch(OPTNEG) error = %v", err)
+	}
+	if s.actions != OptAddRcptPar|OptChangeFrom {
+		t.Errorf("actions = %v, want %v", s.actions, OptAddRcptPar|OptChangeFrom)
+	}
+}
+
+func TestNegotiateOptionsSendsMacroRequests(t *testing.T) {
+	var out bytes.Buffer
+	s := newTestSession(&stubMilter{}, &out)
+	s.macroRequests = map[Stage][]string{StageMail: {"{auth_authen}"}}
+
+	if err := s.dispatch(optnegPacket(RequestedActions)); err != nil {
+		t.Fatalf("dispatch(OPTNEG) error = %v", err)
+	}
+
+	// negotiateOptions writes its own SMFIC_OPTNEG reply followed by the
+	// SMFIC_MACRO packet sendMacroRequests builds; read both back to
+	// confirm the macro packet actually went out.
+	r := bufio.NewReader(&out)
+	optneg, err := readPacket(r)
+	if err != nil || optneg.Code != smficOptneg {
+		t.Fatalf("first packet = %v, %v, want SMFIC_OPTNEG", optneg, err)
+	}
+	macro, err := readPacket(r)
+	if err != nil {
+		t.Fatalf("readPacket(macro) error = %v", err)
+	}
+	if macro.Code != smficMacro {
+		t.Fatalf("second packet Code = %q, want %q (SMFIC_MACRO)", macro.Code, smficMacro)
+	}
+	want := "M{auth_authen}" + null
+	if string(macro.Data) != want {
+		t.Errorf("macro packet Data = %q, want %q", macro.Data, want)
+	}
+}
+
+func TestDispatchAccumulatesHeadersAndBody(t *testing.T) {
+	milter := &stubMilter{}
+	s := newTestSession(milter, &bytes.Buffer{})
+	s.actions = RequestedActions
+
+	if err := s.dispatch(&Message{Code: smficHeader, Data: []byte("Content-Type" + null + "text/plain" + null)}); err != nil {
+		t.Fatalf("dispatch(HEADER) error = %v", err)
+	}
+	if err := s.dispatch(&Message{Code: smficBody, Data: []byte("hello ")}); err != nil {
+		t.Fatalf("dispatch(BODY) error = %v", err)
+	}
+	if err := s.dispatch(&Message{Code: smficBody, Data: []byte("world")}); err != nil {
+		t.Fatalf("dispatch(BODY) error = %v", err)
+	}
+	if err := s.dispatch(&Message{Code: smficBodyEob}); err != nil {
+		t.Fatalf("dispatch(BODYEOB) error = %v", err)
+	}
+
+	if got := milter.headersSeen; len(got) != 1 || got[0] != "Content-Type=text/plain" {
+		t.Fatalf("headersSeen = %v, want [Content-Type=text/plain]", got)
+	}
+	if milter.bodyMod == nil {
+		t.Fatal("Body callback was not invoked with a Modifier")
+	}
+	parsed, err := milter.bodyMod.GetParsedMessage()
+	if err != nil {
+		t.Fatalf("GetParsedMessage() error = %v", err)
+	}
+	if parsed.TextPart != "hello world" {
+		t.Errorf("TextPart = %q, want %q", parsed.TextPart, "hello world")
+	}
+
+	// SMFIC_BODYEOB resets envelope state for the next message on the
+	// connection.
+	if len(s.body) != 0 || len(s.headers) != 0 {
+		t.Errorf("dispatch(BODYEOB) did not reset envelope state: body=%q headers=%v", s.body, s.headers)
+	}
+}
+
+func TestDispatchMailFromAssignsMessageIDBeforeCallback(t *testing.T) {
+	milter := &stubMilter{}
+	s := newTestSession(milter, &bytes.Buffer{})
+	s.sessionID = "conn1"
+
+	if err := s.dispatch(&Message{Code: smficMail, Data: []byte("<a@example.com>" + null)}); err != nil {
+		t.Fatalf("dispatch(MAIL) error = %v", err)
+	}
+	if milter.inits != 1 {
+		t.Fatalf("Init called %d times, want 1", milter.inits)
+	}
+	if milter.lastSession != "conn1" || milter.lastMessage != s.messageID {
+		t.Errorf("Init(%q, %q), want (%q, %q)", milter.lastSession, milter.lastMessage, "conn1", s.messageID)
+	}
+}
+
+func TestParseConnect(t *testing.T) {
+	data := []byte("mail.example.com" + null + string([]byte{4}) + string([]byte{0x1f, 0x90}) + "192.0.2.1" + null)
+	host, family, port, addr := parseConnect(data)
+	if host != "mail.example.com" || family != 4 || port != 8080 || addr.String() != "192.0.2.1" {
+		t.Errorf("parseConnect() = (%q, %d, %d, %v)", host, family, port, addr)
+	}
+}
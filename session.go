@@ -0,0 +1,65 @@
+package milter
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// Session is an optional extension to Milter that receives notifications
+// about the lifecycle of a connection and the envelopes exchanged on it.
+// Init is called at the start of every new envelope, including after a
+// RSET/abort, and Disconnect is called once when the connection's session
+// ends. Implementing Session lets a handler correlate callbacks
+// across stages using the session and message IDs surfaced on Modifier.
+type Session interface {
+	// Init is called when a new envelope starts. sessionID is stable for
+	// the lifetime of the TCP connection; messageID is regenerated for
+	// every MAIL FROM.
+	Init(sessionID, messageID string)
+
+	// Disconnect is called once the session ends: when the MTA closes the
+	// connection or sends SMFIC_QUIT, or when reading or handling a packet
+	// fails.
+	Disconnect()
+}
+
+// DefaultSession provides no-op implementations of Session so that existing
+// Milter implementations can embed it without having to implement the
+// lifecycle callbacks themselves.
+type DefaultSession struct{}
+
+// Init is a no-op default implementation of Session.
+func (DefaultSession) Init(sessionID, messageID string) {}
+
+// Disconnect is a no-op default implementation of Session.
+func (DefaultSession) Disconnect() {}
+
+// newID returns a random 24-character hex identifier. milterSession calls
+// it once per accepted connection to generate the session ID, and again on
+// every MAIL FROM (including after a RSET/abort) to regenerate the message
+// ID.
+func newID() string {
+	var b [12]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// notifyInit calls milter.Init if milter implements Session. milterSession
+// calls this once per envelope, right after assigning sessionID and
+// messageID, so Init always observes the IDs Modifier will report for that
+// envelope.
+func notifyInit(milter Milter, sessionID, messageID string) {
+	if s, ok := milter.(Session); ok {
+		s.Init(sessionID, messageID)
+	}
+}
+
+// notifyDisconnect calls milter.Disconnect if milter implements Session.
+// milterSession calls this once, when its serve loop returns for any reason.
+func notifyDisconnect(milter Milter) {
+	if s, ok := milter.(Session); ok {
+		s.Disconnect()
+	}
+}
@@ -0,0 +1,20 @@
+package milter
+
+import "testing"
+
+func TestNewIDLooksRandomAndHex(t *testing.T) {
+	a, b := newID(), newID()
+	if len(a) != 24 || len(b) != 24 {
+		t.Fatalf("newID() lengths = %d, %d, want 24", len(a), len(b))
+	}
+	if a == b {
+		t.Fatalf("newID() returned the same value twice: %q", a)
+	}
+	for _, id := range []string{a, b} {
+		for _, c := range id {
+			if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f')) {
+				t.Fatalf("newID() = %q, contains non-hex character %q", id, c)
+			}
+		}
+	}
+}
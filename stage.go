@@ -0,0 +1,17 @@
+package milter
+
+// Stage identifies a protocol step at which the MTA invokes a milter
+// callback and, correspondingly, a point at which SMFIC_MACRO macros can be
+// requested.
+type Stage int
+
+const (
+	StageConnect Stage = iota
+	StageHelo
+	StageMail
+	StageRcpt
+	StageData
+	StageEOH
+	StageEOM
+	StageUnknown
+)